@@ -0,0 +1,117 @@
+package rsync
+
+import "fmt"
+
+// DefaultBlockSize is the default fixed block size, in bytes, used for signature generation and delta sync when the
+// caller doesn't request content-defined chunking.
+const DefaultBlockSize = 4096
+
+// SignatureStream carries a stream of BlockChecksum alongside the HashAlgo used to compute their Strong field, so
+// the receiving side of a sync can reject a stream hashed with an algorithm it didn't expect instead of silently
+// comparing checksums produced by two different algorithms.
+type SignatureStream struct {
+	Algo   HashAlgo
+	Blocks <-chan BlockChecksum
+}
+
+// BlockChecksum is the weak/strong checksum pair computed over a single block of the remote file during signature
+// generation. The sender uses it to find blocks it can skip re-sending.
+type BlockChecksum struct {
+	// Index is the sequential index of the block within the remote file.
+	Index uint64
+	// Offset is the byte offset of the block within the remote file.
+	Offset int64
+	// Length is the length, in bytes, of the block.
+	Length int64
+	// Weak is the rolling (Adler-32 style) checksum of the block, used as a cheap first filter.
+	Weak uint32
+	// Strong is the cryptographic checksum of the block, used to confirm a weak-hash candidate match.
+	Strong []byte
+	// Error is set if computing this checksum failed. The caller should log it and proceed; worst case the
+	// block in question is re-sent as a literal.
+	Error error
+	// Temporary marks a checksum as describing the receiver's own in-progress staging file rather than the
+	// finalized remote file. Sync only proposes matches against these when SyncOptions.AllowTemporarySource is
+	// set, since the receiver may still discard that file.
+	Temporary bool
+}
+
+// Source identifies where the receiver should read a copy operation's bytes from.
+type Source uint8
+
+const (
+	// SourceRemote indicates the bytes should come from the finalized remote file. This is the zero value.
+	SourceRemote Source = iota
+	// SourceTemporary indicates the bytes should come from the receiver's own in-progress staging file (e.g.
+	// foo.part), because an earlier BlockChecksum marked Temporary matched there. Only ever set when the
+	// corresponding SyncOptions.AllowTemporarySource was true.
+	SourceTemporary
+)
+
+// String implements fmt.Stringer.
+func (s Source) String() string {
+	switch s {
+	case SourceRemote:
+		return "remote"
+	case SourceTemporary:
+		return "temporary"
+	default:
+		return fmt.Sprintf("Source(%d)", uint8(s))
+	}
+}
+
+// OpKind identifies which payload fields of a BlockOperation are meaningful.
+type OpKind uint8
+
+const (
+	// OpLiteral indicates Data holds the literal bytes the receiver should write verbatim. This is the zero
+	// value so operations constructed without setting Kind are treated as literal, which was the only kind
+	// that existed before OpCopy and OpStoreRef were introduced.
+	OpLiteral OpKind = iota
+	// OpCopy indicates the receiver should copy block IndexB from the remote file.
+	OpCopy
+	// OpStoreRef indicates StoreRef holds the strong hash of a block the receiver should fetch from a shared
+	// block store instead of the remote file. See SyncWithStore.
+	OpStoreRef
+)
+
+// BlockOperation instructs the receiver how to reconstruct one segment of the file being synced.
+type BlockOperation struct {
+	// Index is the sequential index of this operation in emission order.
+	Index uint64
+	// Kind says which of IndexB, Data, or StoreRef is meaningful.
+	Kind OpKind
+	// IndexB is the index of the matching remote block to copy from. Only meaningful when Kind == OpCopy.
+	IndexB uint64
+	// RemoteOffset and Length describe the byte range to copy from the remote file. Only meaningful when
+	// Kind == OpCopy.
+	RemoteOffset int64
+	Length       int64
+	// Source says whether RemoteOffset is relative to the finalized remote file or the receiver's own
+	// in-progress staging file. Only meaningful when Kind == OpCopy.
+	Source Source
+	// WeakOnly indicates this match was proposed from the weak checksum alone, without strong-hash
+	// confirmation, because the caller set SyncOptions.TrustWeakHash. The receiver should treat it with
+	// whatever extra scrutiny that trust level warrants. Only meaningful when Kind == OpCopy.
+	WeakOnly bool
+	// Data is literal bytes the receiver should write verbatim. Only meaningful when Kind == OpLiteral.
+	Data []byte
+	// StoreRef is the strong hash of a block the receiver should fetch from the shared block store. Only
+	// meaningful when Kind == OpStoreRef.
+	StoreRef []byte
+	// Error, when set, indicates Sync failed and the stream should be treated as incomplete.
+	Error error
+}
+
+// SyncOptions controls optional, riskier matching behavior for Sync.
+type SyncOptions struct {
+	// TrustWeakHash lets Sync propose a match using only the weak checksum, skipping strong-hash confirmation,
+	// for workloads trusted enough that a weak-hash collision is an acceptable risk (e.g. bulk initial seeding
+	// over a private link). Matches proposed this way have BlockOperation.WeakOnly set.
+	TrustWeakHash bool
+	// AllowTemporarySource lets Sync propose matches against BlockChecksums marked Temporary -- blocks the
+	// receiver already staged to an in-progress temporary file during this same sync -- instead of only ever
+	// matching against the finalized remote file. Matches proposed this way have
+	// BlockOperation.Source == SourceTemporary.
+	AllowTemporarySource bool
+}
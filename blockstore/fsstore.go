@@ -0,0 +1,79 @@
+package blockstore
+
+import (
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// FSStore is a filesystem-backed Store. Blocks are stored under Root as <algo>/<hh>/<hh>/<full-hex>: two levels
+// of two-hex-character fan-out directories, so that no single directory ends up holding an unbounded number of
+// files as the store grows. Algo namespaces that path by the name of the hash algorithm the caller strong-hashes
+// blocks with (e.g. "sha256", "blake3", "xxh3") -- Put/Get/Has take only the strong hash bytes, with no way to
+// tell two different algorithms' output apart otherwise, so a single FSStore must only ever be used with blocks
+// hashed by one algorithm. The zero value namespaces under "sha256", for callers that only ever use one algorithm
+// and constructed an FSStore directly rather than through NewFSStore.
+type FSStore struct {
+	Root string
+	Algo string
+}
+
+// NewFSStore returns an FSStore rooted at root, namespaced under algo (e.g. "sha256", "blake3", "xxh3"). The
+// directory is created lazily on first Put.
+func NewFSStore(root, algo string) *FSStore {
+	return &FSStore{Root: root, Algo: algo}
+}
+
+func (s *FSStore) path(strong []byte) string {
+	algo := s.Algo
+	if algo == "" {
+		algo = "sha256"
+	}
+	h := hex.EncodeToString(strong)
+	if len(h) < 4 {
+		return filepath.Join(s.Root, algo, h)
+	}
+	return filepath.Join(s.Root, algo, h[:2], h[2:4], h)
+}
+
+// Put implements Store.
+func (s *FSStore) Put(strong []byte, data []byte) error {
+	p := s.path(strong)
+	if _, err := os.Stat(p); err == nil {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		return fmt.Errorf("blockstore: creating directory for %x: %w", strong, err)
+	}
+
+	// Write to a temp file first and rename into place so a concurrent Get never observes a partial write.
+	tmp := p + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("blockstore: writing %x: %w", strong, err)
+	}
+	if err := os.Rename(tmp, p); err != nil {
+		return fmt.Errorf("blockstore: finalizing %x: %w", strong, err)
+	}
+	return nil
+}
+
+// Get implements Store.
+func (s *FSStore) Get(strong []byte) ([]byte, error) {
+	data, err := os.ReadFile(s.path(strong))
+	if err != nil {
+		return nil, fmt.Errorf("blockstore: reading %x: %w", strong, err)
+	}
+	return data, nil
+}
+
+// Has implements Store.
+func (s *FSStore) Has(strong []byte) (bool, error) {
+	if _, err := os.Stat(s.path(strong)); err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, fmt.Errorf("blockstore: checking %x: %w", strong, err)
+	}
+	return true, nil
+}
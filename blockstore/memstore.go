@@ -0,0 +1,54 @@
+package blockstore
+
+import (
+	"fmt"
+	"sync"
+)
+
+// MemStore is an in-memory Store. It's primarily useful in tests and other places a real filesystem- or
+// object-storage-backed Store would be overkill.
+type MemStore struct {
+	mu     sync.RWMutex
+	blocks map[string][]byte
+}
+
+// NewMemStore returns an empty MemStore.
+func NewMemStore() *MemStore {
+	return &MemStore{blocks: make(map[string][]byte)}
+}
+
+// Put implements Store.
+func (s *MemStore) Put(strong []byte, data []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	k := string(strong)
+	if _, ok := s.blocks[k]; ok {
+		return nil
+	}
+	cp := make([]byte, len(data))
+	copy(cp, data)
+	s.blocks[k] = cp
+	return nil
+}
+
+// Get implements Store.
+func (s *MemStore) Get(strong []byte) ([]byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	data, ok := s.blocks[string(strong)]
+	if !ok {
+		return nil, fmt.Errorf("blockstore: %x not found", strong)
+	}
+	return data, nil
+}
+
+// Has implements Store.
+func (s *MemStore) Has(strong []byte) (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	_, ok := s.blocks[string(strong)]
+	return ok, nil
+}
@@ -0,0 +1,15 @@
+// Package blockstore provides a content-addressable store for blocks keyed by their strong hash, letting Sync
+// dedup blocks across files: before re-sending a literal, the caller checks whether an identical block has
+// already been stored by some other sync, and if so asks the receiver to fetch it from the store instead.
+package blockstore
+
+// Store is a content-addressable block store keyed by strong hash.
+type Store interface {
+	// Put stores data under strong, the block's strong hash. Calling Put with a hash that's already present
+	// is a no-op.
+	Put(strong []byte, data []byte) error
+	// Get returns the data previously stored under strong.
+	Get(strong []byte) ([]byte, error)
+	// Has reports whether strong is already present in the store.
+	Has(strong []byte) (bool, error)
+}
@@ -0,0 +1,84 @@
+package blockstore
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+)
+
+func testStore(t *testing.T, store Store) {
+	t.Helper()
+
+	strong := []byte{0xde, 0xad, 0xbe, 0xef}
+	data := []byte("hello, block store")
+
+	if has, err := store.Has(strong); err != nil || has {
+		t.Fatalf("Has on empty store = (%v, %v), want (false, nil)", has, err)
+	}
+
+	if err := store.Put(strong, data); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	if err := store.Put(strong, []byte("different data, should be ignored")); err != nil {
+		t.Fatalf("second Put (no-op) returned an error: %v", err)
+	}
+
+	if has, err := store.Has(strong); err != nil || !has {
+		t.Fatalf("Has after Put = (%v, %v), want (true, nil)", has, err)
+	}
+
+	got, err := store.Get(strong)
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Fatalf("Get = %q, want %q (a second Put with the same hash must not overwrite the first)", got, data)
+	}
+
+	if _, err := store.Get([]byte{0x00, 0x11, 0x22, 0x33}); err == nil {
+		t.Fatal("Get on an absent hash returned no error")
+	}
+}
+
+func TestMemStore(t *testing.T) {
+	testStore(t, NewMemStore())
+}
+
+func TestFSStore(t *testing.T) {
+	testStore(t, NewFSStore(t.TempDir(), "sha256"))
+}
+
+// TestFSStoreNamespacesByAlgo checks that two FSStores rooted at the same directory but constructed with
+// different Algo values never collide on disk, even given the same strong hash bytes.
+func TestFSStoreNamespacesByAlgo(t *testing.T) {
+	root := t.TempDir()
+	sha := NewFSStore(root, "sha256")
+	blake := NewFSStore(root, "blake3")
+
+	strong := []byte{0xaa, 0xbb, 0xcc, 0xdd}
+	if err := sha.Put(strong, []byte("sha256 data")); err != nil {
+		t.Fatalf("Put (sha256): %v", err)
+	}
+	if err := blake.Put(strong, []byte("blake3 data")); err != nil {
+		t.Fatalf("Put (blake3): %v", err)
+	}
+
+	shaData, err := sha.Get(strong)
+	if err != nil {
+		t.Fatalf("Get (sha256): %v", err)
+	}
+	blakeData, err := blake.Get(strong)
+	if err != nil {
+		t.Fatalf("Get (blake3): %v", err)
+	}
+	if string(shaData) == string(blakeData) {
+		t.Fatalf("sha256 and blake3 stores returned the same data for the same strong hash -- they collided on disk")
+	}
+
+	if got := sha.path(strong); filepath.Base(filepath.Dir(filepath.Dir(filepath.Dir(got)))) != "sha256" {
+		t.Fatalf("sha256 store's path %q isn't namespaced under sha256/", got)
+	}
+	if got := blake.path(strong); filepath.Base(filepath.Dir(filepath.Dir(filepath.Dir(got)))) != "blake3" {
+		t.Fatalf("blake3 store's path %q isn't namespaced under blake3/", got)
+	}
+}
@@ -0,0 +1,205 @@
+package rsync
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"math/bits"
+)
+
+// Default size bounds used by FastCDC when the caller leaves a field unset.
+const (
+	DefaultMinSize = 2 * 1024
+	DefaultAvgSize = 8 * 1024
+	DefaultMaxSize = 64 * 1024
+)
+
+// Chunk is a single block produced by a Chunker, at a given offset in the stream it was read from. Err is set, on
+// the final Chunk a Chunker sends, if reading the underlying stream failed with something other than a clean EOF --
+// the caller should treat the chunks seen so far as incomplete rather than a full read of the stream.
+type Chunk struct {
+	Offset int64
+	Data   []byte
+	Err    error
+}
+
+// Chunker splits a stream into blocks for signature generation and sync. FixedSize produces fixed, non-overlapping
+// blocks. FastCDC produces content-defined chunks whose boundaries are derived from the data itself, so an
+// insertion or deletion only shifts the one or two chunks around the edit instead of every chunk after it.
+type Chunker interface {
+	// Chunks reads r to completion and sends each chunk, in order, on the returned channel. The channel is
+	// closed once r is exhausted, an error is hit, or ctx is cancelled.
+	Chunks(ctx context.Context, r io.Reader) <-chan Chunk
+}
+
+// FixedSize chunks a stream into blocks of Size bytes each (the final block may be shorter). A zero Size falls
+// back to DefaultBlockSize.
+type FixedSize struct {
+	Size int
+}
+
+// Chunks implements Chunker.
+func (f FixedSize) Chunks(ctx context.Context, r io.Reader) <-chan Chunk {
+	size := f.Size
+	if size <= 0 {
+		size = DefaultBlockSize
+	}
+
+	out := make(chan Chunk)
+	go func() {
+		defer close(out)
+		var offset int64
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			default:
+			}
+
+			buf := make([]byte, size)
+			n, err := io.ReadFull(r, buf)
+			if err == io.EOF {
+				return
+			}
+			if err != nil && err != io.ErrUnexpectedEOF {
+				select {
+				case out <- Chunk{Offset: offset, Err: err}:
+				case <-ctx.Done():
+				}
+				return
+			}
+			select {
+			case out <- Chunk{Offset: offset, Data: buf[:n]}:
+			case <-ctx.Done():
+				return
+			}
+			offset += int64(n)
+		}
+	}()
+	return out
+}
+
+// FastCDC chunks a stream into content-defined blocks using a rolling gear hash, following the FastCDC algorithm:
+// a chunk boundary is declared when the low bits of the gear hash are all zero, with a stricter mask (maskS)
+// applied before AvgSize to discourage premature boundaries and a looser mask (maskL) applied after AvgSize to
+// encourage the chunk to close. MinSize and MaxSize are hard bounds regardless of the hash. Zero fields fall back
+// to DefaultMinSize/DefaultAvgSize/DefaultMaxSize.
+type FastCDC struct {
+	MinSize, AvgSize, MaxSize int
+}
+
+// Chunks implements Chunker.
+func (f FastCDC) Chunks(ctx context.Context, r io.Reader) <-chan Chunk {
+	minSize, avgSize, maxSize := f.MinSize, f.AvgSize, f.MaxSize
+	if minSize <= 0 {
+		minSize = DefaultMinSize
+	}
+	if avgSize <= 0 {
+		avgSize = DefaultAvgSize
+	}
+	if maxSize <= 0 {
+		maxSize = DefaultMaxSize
+	}
+	maskS, maskL := cdcMasks(avgSize)
+
+	out := make(chan Chunk)
+	go func() {
+		defer close(out)
+		br := bufio.NewReaderSize(r, maxSize)
+		var offset int64
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			default:
+			}
+
+			data, err := cdcNextChunk(br, minSize, avgSize, maxSize, maskS, maskL)
+			if err != nil && err != io.EOF {
+				select {
+				case out <- Chunk{Offset: offset, Err: err}:
+				case <-ctx.Done():
+				}
+				return
+			}
+			if len(data) > 0 {
+				select {
+				case out <- Chunk{Offset: offset, Data: data}:
+				case <-ctx.Done():
+					return
+				}
+				offset += int64(len(data))
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+	return out
+}
+
+// cdcNextChunk reads br one byte at a time, advancing the gear hash, until it crosses a chunk boundary or runs
+// out of input. It returns the bytes read so far along with any error from br (including io.EOF).
+func cdcNextChunk(br *bufio.Reader, minSize, avgSize, maxSize int, maskS, maskL uint64) ([]byte, error) {
+	var h uint64
+	data := make([]byte, 0, avgSize)
+	for {
+		b, err := br.ReadByte()
+		if err != nil {
+			return data, err
+		}
+		data = append(data, b)
+		h = (h << 1) + gearTable[b]
+
+		n := len(data)
+		if n < minSize {
+			continue
+		}
+		if n >= maxSize {
+			return data, nil
+		}
+		mask := maskL
+		if n < avgSize {
+			mask = maskS
+		}
+		if h&mask == 0 {
+			return data, nil
+		}
+	}
+}
+
+// cdcMasks derives the stricter/looser gear-hash boundary masks from the average chunk size: maskS requires two
+// more low bits to be zero than a boundary at exactly avgSize would need, maskL two fewer, which is what keeps the
+// chunk size distribution tight around avgSize per the FastCDC paper.
+func cdcMasks(avgSize int) (maskS, maskL uint64) {
+	n := bits.Len(uint(avgSize))
+	return maskOfBits(n + 2), maskOfBits(n - 2)
+}
+
+func maskOfBits(n int) uint64 {
+	switch {
+	case n <= 0:
+		return 0
+	case n >= 64:
+		return ^uint64(0)
+	default:
+		return (uint64(1) << n) - 1
+	}
+}
+
+// gearTable is a fixed pseudo-random table of 64-bit values indexed by byte value, used by the FastCDC gear hash.
+// It's derived from a fixed-seed splitmix64 sequence so chunk boundaries (and therefore dedup ratios) are stable
+// across runs and builds.
+var gearTable = func() [256]uint64 {
+	var t [256]uint64
+	x := uint64(0x9e3779b97f4a7c15)
+	for i := range t {
+		x += 0x9e3779b97f4a7c15
+		z := x
+		z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+		z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+		z ^= z >> 31
+		t[i] = z
+	}
+	return t
+}()
@@ -0,0 +1,135 @@
+package rsync
+
+import (
+	"bytes"
+	"context"
+	"math/rand"
+	"testing"
+)
+
+func collectChunks(t *testing.T, chunker Chunker, data []byte) []Chunk {
+	t.Helper()
+	chunks, err := chunkAll(chunker, data)
+	if err != nil {
+		t.Fatalf("unexpected chunk error: %v", err)
+	}
+	return chunks
+}
+
+func chunkAll(chunker Chunker, data []byte) ([]Chunk, error) {
+	var chunks []Chunk
+	for c := range chunker.Chunks(context.Background(), bytes.NewReader(data)) {
+		if c.Err != nil {
+			return nil, c.Err
+		}
+		chunks = append(chunks, c)
+	}
+	return chunks, nil
+}
+
+// TestFastCDCBounds checks that every chunk FastCDC produces (other than a final short tail) falls within
+// [MinSize, MaxSize], and that concatenating the chunks reproduces the input exactly.
+func TestFastCDCBounds(t *testing.T) {
+	data := make([]byte, 500*1024)
+	rand.New(rand.NewSource(42)).Read(data)
+
+	f := FastCDC{MinSize: 2 * 1024, AvgSize: 8 * 1024, MaxSize: 64 * 1024}
+	chunks := collectChunks(t, f, data)
+
+	var got []byte
+	for i, c := range chunks {
+		got = append(got, c.Data...)
+		if i < len(chunks)-1 {
+			if len(c.Data) < f.MinSize || len(c.Data) > f.MaxSize {
+				t.Fatalf("chunk %d has length %d, want [%d, %d]", i, len(c.Data), f.MinSize, f.MaxSize)
+			}
+		} else if len(c.Data) > f.MaxSize {
+			t.Fatalf("final chunk %d has length %d > MaxSize %d", i, len(c.Data), f.MaxSize)
+		}
+	}
+	if !bytes.Equal(got, data) {
+		t.Fatalf("concatenated chunks don't reproduce the input: got %d bytes, want %d", len(got), len(data))
+	}
+}
+
+// TestFastCDCStableAcrossInsertion is the property content-defined chunking exists for: inserting bytes in the
+// middle of the stream should only change the one or two chunks around the edit, not every chunk boundary after
+// it, unlike fixed-size chunking which shifts everything downstream of an edit.
+func TestFastCDCStableAcrossInsertion(t *testing.T) {
+	data := make([]byte, 200*1024)
+	rand.New(rand.NewSource(7)).Read(data)
+
+	inserted := make([]byte, len(data)+13)
+	copy(inserted, data[:100*1024])
+	copy(inserted[100*1024:], bytes.Repeat([]byte{0xAB}, 13))
+	copy(inserted[100*1024+13:], data[100*1024:])
+
+	f := FastCDC{MinSize: 2 * 1024, AvgSize: 8 * 1024, MaxSize: 64 * 1024}
+	before := collectChunks(t, f, data)
+	after := collectChunks(t, f, inserted)
+
+	beforeSet := make(map[uint32]int)
+	for _, c := range before {
+		beforeSet[rollingHash(c.Data)]++
+	}
+	shared := 0
+	for _, c := range after {
+		if beforeSet[rollingHash(c.Data)] > 0 {
+			beforeSet[rollingHash(c.Data)]--
+			shared++
+		}
+	}
+	// Most chunks should survive the insertion untouched; only the handful straddling the edit should differ.
+	if shared < len(before)-4 {
+		t.Fatalf("insertion changed too many chunks: %d/%d survived untouched", shared, len(before))
+	}
+}
+
+// BenchmarkDedupRatio reports, for FastCDC vs FixedSize, how much of a lightly-edited copy of a file can be
+// expressed as block matches against the original -- the dedup ratio FastCDC's content-defined boundaries exist to
+// improve after an insertion shifts everything downstream of it out of fixed-block alignment.
+func BenchmarkDedupRatio(b *testing.B) {
+	data := make([]byte, 2*1024*1024)
+	rand.New(rand.NewSource(99)).Read(data)
+
+	edited := make([]byte, len(data)+77)
+	copy(edited, data[:len(data)/2])
+	copy(edited[len(data)/2:], bytes.Repeat([]byte{0x42}, 77))
+	copy(edited[len(data)/2+77:], data[len(data)/2:])
+
+	chunkers := map[string]Chunker{
+		"FixedSize": FixedSize{Size: 8 * 1024},
+		"FastCDC":   FastCDC{MinSize: 2 * 1024, AvgSize: 8 * 1024, MaxSize: 64 * 1024},
+	}
+
+	for name, chunker := range chunkers {
+		b.Run(name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				origChunks, err := chunkAll(chunker, data)
+				if err != nil {
+					b.Fatalf("unexpected chunk error: %v", err)
+				}
+				orig := make(map[uint32]int)
+				for _, c := range origChunks {
+					orig[rollingHash(c.Data)]++
+				}
+
+				editedChunks, err := chunkAll(chunker, edited)
+				if err != nil {
+					b.Fatalf("unexpected chunk error: %v", err)
+				}
+				matched, total := 0, 0
+				for _, c := range editedChunks {
+					total += len(c.Data)
+					if orig[rollingHash(c.Data)] > 0 {
+						orig[rollingHash(c.Data)]--
+						matched += len(c.Data)
+					}
+				}
+				if total > 0 {
+					b.ReportMetric(float64(matched)/float64(total)*100, "%dedup")
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,15 @@
+// Package rsync implements an rsync-style delta sync: one side generates a Signature of its copy of a file, the
+// other side walks its own copy of the file, matches blocks against that signature, and emits a stream of
+// BlockOperations (literal data, or a reference to a block the receiver already has) that let the receiver
+// reconstruct the sender's file while transferring only the bytes that actually changed.
+//
+// # Choosing a strong hash
+//
+// Sync and Signature take a HashAlgo to confirm weak-checksum candidates. HashSHA256 and HashBLAKE3 are
+// cryptographically secure: an adversary who can choose the contents of the block being synced cannot produce a
+// different block with the same checksum, which matters if you're syncing from an untrusted or adversarial
+// source. HashXXH3 is significantly faster but is not cryptographically secure -- collisions can be engineered
+// deliberately. Use HashXXH3 only for trusted workloads (e.g. syncing between hosts you control, where data
+// corruption rather than a malicious peer is the threat model you're guarding against), the same bar restic
+// applies when it uses a non-cryptographic hash for its own internal integrity checks.
+package rsync
@@ -0,0 +1,152 @@
+package rsync
+
+import (
+	"container/heap"
+	"context"
+	"io"
+	"sync"
+)
+
+// ParallelSignature behaves like Signature with a fixed-size chunker of blockSize bytes, but computes block
+// checksums concurrently: a producer goroutine reads sequential blocks and dispatches them over a bounded channel
+// to a pool of workers workers, each with its own StrongHasher for algo, so hashing one block never waits on
+// another. Results are reassembled into original index order, using a small min-heap keyed by block index, before
+// being sent on the returned channel.
+func ParallelSignature(ctx context.Context, r io.Reader, workers int, blockSize int, algo HashAlgo) (SignatureStream, error) {
+	if _, err := algo.Hasher(); err != nil {
+		return SignatureStream{}, err
+	}
+	if workers <= 0 {
+		workers = 1
+	}
+	if blockSize <= 0 {
+		blockSize = DefaultBlockSize
+	}
+
+	jobs := make(chan indexedBlock, workers)
+	results := make(chan BlockChecksum, workers)
+
+	go produceBlocks(ctx, r, blockSize, jobs)
+
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go func() {
+			defer wg.Done()
+			// Hasher() can't fail here: it was already validated above.
+			hasher, _ := algo.Hasher()
+			hashBlocks(jobs, results, hasher)
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	return SignatureStream{Algo: algo, Blocks: reorderChecksums(ctx, results)}, nil
+}
+
+// indexedBlock is a fixed-size block read by produceBlocks, tagged with its sequential position and offset in the
+// input. err is set, on the final indexedBlock produceBlocks sends, if reading r failed with something other than
+// a clean EOF.
+type indexedBlock struct {
+	index  uint64
+	offset int64
+	data   []byte
+	err    error
+}
+
+// produceBlocks reads r in sequential blockSize chunks and sends each on jobs, closing it once r is exhausted,
+// an error is hit, or ctx is cancelled.
+func produceBlocks(ctx context.Context, r io.Reader, blockSize int, jobs chan<- indexedBlock) {
+	defer close(jobs)
+
+	var index uint64
+	var offset int64
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		default:
+		}
+
+		buf := make([]byte, blockSize)
+		n, err := io.ReadFull(r, buf)
+		if err == io.EOF {
+			return
+		}
+		if err != nil && err != io.ErrUnexpectedEOF {
+			select {
+			case jobs <- indexedBlock{index: index, err: err}:
+			case <-ctx.Done():
+			}
+			return
+		}
+		select {
+		case jobs <- indexedBlock{index: index, offset: offset, data: buf[:n]}:
+		case <-ctx.Done():
+			return
+		}
+		index++
+		offset += int64(n)
+	}
+}
+
+// hashBlocks computes the weak and strong checksum of every block on jobs using hasher, and sends each result on
+// results.
+func hashBlocks(jobs <-chan indexedBlock, results chan<- BlockChecksum, hasher StrongHasher) {
+	for b := range jobs {
+		if b.err != nil {
+			results <- BlockChecksum{Index: b.index, Error: b.err}
+			continue
+		}
+		results <- BlockChecksum{
+			Index:  b.index,
+			Offset: b.offset,
+			Length: int64(len(b.data)),
+			Weak:   rollingHash(b.data),
+			Strong: hasher.Sum(nil, b.data),
+		}
+	}
+}
+
+// reorderChecksums reassembles results, which may arrive out of order, into original index order using a min-heap,
+// emitting each BlockChecksum on the returned channel as soon as its turn comes up.
+func reorderChecksums(ctx context.Context, results <-chan BlockChecksum) <-chan BlockChecksum {
+	out := make(chan BlockChecksum)
+	go func() {
+		defer close(out)
+
+		pending := &checksumHeap{}
+		var next uint64
+		for res := range results {
+			heap.Push(pending, res)
+			for pending.Len() > 0 && (*pending)[0].Index == next {
+				sum := heap.Pop(pending).(BlockChecksum)
+				select {
+				case out <- sum:
+				case <-ctx.Done():
+					return
+				}
+				next++
+			}
+		}
+	}()
+	return out
+}
+
+// checksumHeap is a min-heap of BlockChecksum ordered by Index.
+type checksumHeap []BlockChecksum
+
+func (h checksumHeap) Len() int            { return len(h) }
+func (h checksumHeap) Less(i, j int) bool  { return h[i].Index < h[j].Index }
+func (h checksumHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *checksumHeap) Push(x interface{}) { *h = append(*h, x.(BlockChecksum)) }
+
+func (h *checksumHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	item := old[n-1]
+	*h = old[:n-1]
+	return item
+}
@@ -0,0 +1,262 @@
+package rsync
+
+import (
+	"context"
+	"encoding/gob"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// Segment describes how to reconstruct one contiguous byte range of the destination file: either copy Length
+// bytes from RemoteOffset in the remote file, or (when RemoteOffset is negative) write Data verbatim.
+type Segment struct {
+	DstOffset    int64
+	Length       int64
+	RemoteOffset int64
+	Data         []byte
+}
+
+// Plan describes how to reconstruct an entire destination file from a stream of BlockOperations, so that Apply
+// can write its segments concurrently and in any order instead of strictly following emission order.
+type Plan struct {
+	Segments []Segment
+	// Size is the total size of the destination file once every segment has been applied.
+	Size int64
+}
+
+// BuildPlan consumes every BlockOperation on ops, in order, and produces a Plan describing the destination file
+// they reconstruct. It fails on the first BlockOperation carrying a non-nil Error, one with OpStoreRef, which Apply
+// has no way to resolve without a blockstore.Store (use SyncWithStore's operations to populate the destination
+// directly instead of through a Plan, until Plan/Apply learn to take a Store too), or one with
+// Source == SourceTemporary, since Apply only ever reads copy segments from a single remote ReaderAt and has
+// nowhere to resolve a reference to the receiver's temporary file (use Sync with SyncOptions.AllowTemporarySource
+// unset when building a Plan).
+func BuildPlan(ctx context.Context, ops <-chan BlockOperation) (*Plan, error) {
+	var plan Plan
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case op, ok := <-ops:
+			if !ok {
+				return &plan, nil
+			}
+			if op.Error != nil {
+				return nil, errors.Wrap(op.Error, "sync failed")
+			}
+
+			seg := Segment{DstOffset: plan.Size, RemoteOffset: -1}
+			switch op.Kind {
+			case OpLiteral:
+				seg.Data = op.Data
+				seg.Length = int64(len(op.Data))
+			case OpCopy:
+				if op.Source == SourceTemporary {
+					return nil, errors.Errorf("rsync: BuildPlan can't handle a copy from the temporary source (block operation %d)", op.Index)
+				}
+				seg.RemoteOffset = op.RemoteOffset
+				seg.Length = op.Length
+			default:
+				return nil, errors.Errorf("rsync: BuildPlan can't handle op kind %v (block operation %d)", op.Kind, op.Index)
+			}
+
+			plan.Segments = append(plan.Segments, seg)
+			plan.Size += seg.Length
+		}
+	}
+}
+
+// SavePlan persists plan to path. Because BuildPlan consumes a channel that can't be replayed, a resumed Apply
+// needs the plan saved up front rather than rebuilt after a crash.
+func SavePlan(path string, plan *Plan) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return errors.Wrap(err, "creating plan file")
+	}
+	defer f.Close()
+	if err := gob.NewEncoder(f).Encode(plan); err != nil {
+		return errors.Wrap(err, "encoding plan")
+	}
+	return nil
+}
+
+// LoadPlan loads a plan previously saved with SavePlan.
+func LoadPlan(path string) (*Plan, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "opening plan file")
+	}
+	defer f.Close()
+	var plan Plan
+	if err := gob.NewDecoder(f).Decode(&plan); err != nil {
+		return nil, errors.Wrap(err, "decoding plan")
+	}
+	return &plan, nil
+}
+
+// Apply executes plan with workers goroutines, each copying or writing one segment at a time into dst via
+// WriteAt (and, for copy segments, reading from remote via ReadAt). Because segments are applied out of order,
+// dst is truncated to plan.Size up front so WriteAt can land anywhere in the file, including past the segments
+// that haven't been applied yet.
+//
+// If progressPath is non-empty, Apply persists a per-segment completion bitmap there as segments finish, and
+// skips any segment the bitmap already marks done -- so a process that resumes Apply with the same plan and
+// progressPath picks up where an earlier, interrupted run left off instead of re-copying everything. This trades
+// a guarantee for resumability: if Apply is interrupted, dst may contain a valid copy of some segments and
+// leftover or zero bytes for others, with no way to tell which from the file alone (the same trade-off restic's
+// changelog notes for its own out-of-order restore) -- dst should not be treated as valid until Apply returns
+// without error. The bitmap itself is only flushed to progressPath every progressFlushInterval completions (plus
+// once more after the last segment), rather than re-encoding and renaming the whole bitmap on every single
+// completion -- for a plan with n segments, a flush per completion is O(n) work n times over, serializing the
+// workers this function exists to run concurrently. Batching means an interruption can lose up to
+// progressFlushInterval-1 completions' worth of progress and re-copy them on resume, the same way it can already
+// lose a segment that was mid-write.
+func Apply(ctx context.Context, plan *Plan, dst io.WriterAt, remote io.ReaderAt, workers int, progressPath string) error {
+	if workers <= 0 {
+		workers = 1
+	}
+
+	if t, ok := dst.(interface{ Truncate(size int64) error }); ok {
+		if err := t.Truncate(plan.Size); err != nil {
+			return errors.Wrap(err, "preallocating destination file")
+		}
+	}
+
+	done, err := loadProgress(progressPath, len(plan.Segments))
+	if err != nil {
+		return errors.Wrap(err, "loading progress")
+	}
+
+	jobs := make(chan int)
+	go func() {
+		defer close(jobs)
+		for i, ok := range done {
+			if ok {
+				continue
+			}
+			select {
+			case jobs <- i:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	var mu sync.Mutex
+	var sinceFlush int
+	errs := make(chan error, workers)
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for w := 0; w < workers; w++ {
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				if err := applySegment(dst, remote, plan.Segments[i]); err != nil {
+					errs <- errors.Wrapf(err, "applying segment %d", i)
+					return
+				}
+
+				mu.Lock()
+				done[i] = true
+				sinceFlush++
+				var saveErr error
+				if sinceFlush >= progressFlushInterval {
+					saveErr = saveProgress(progressPath, done)
+					sinceFlush = 0
+				}
+				mu.Unlock()
+				if saveErr != nil {
+					errs <- errors.Wrap(saveErr, "saving progress")
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	// Flush whatever's left of the last, possibly-partial batch so a completed (or failed-but-partially-done) run
+	// doesn't leave up to progressFlushInterval-1 completions unpersisted. Skipped when nothing happened since
+	// the last flush (e.g. resuming an already-fully-done plan), so a no-op resume stays a no-op.
+	if sinceFlush > 0 {
+		if err := saveProgress(progressPath, done); err != nil {
+			return errors.Wrap(err, "saving progress")
+		}
+	}
+
+	for err := range errs {
+		return err
+	}
+	return ctx.Err()
+}
+
+// progressFlushInterval caps how often Apply re-encodes and persists its completion bitmap: once every this many
+// segment completions, rather than once per completion, which would make progress-tracking (and therefore the
+// concurrency Apply's workers are meant to provide) O(n^2) in the number of segments.
+const progressFlushInterval = 256
+
+// applySegment writes one Segment to dst, reading it from remote first if it's a copy rather than a literal.
+func applySegment(dst io.WriterAt, remote io.ReaderAt, seg Segment) error {
+	if seg.RemoteOffset < 0 {
+		_, err := dst.WriteAt(seg.Data, seg.DstOffset)
+		return err
+	}
+
+	buf := make([]byte, seg.Length)
+	if _, err := remote.ReadAt(buf, seg.RemoteOffset); err != nil {
+		return err
+	}
+	_, err := dst.WriteAt(buf, seg.DstOffset)
+	return err
+}
+
+// loadProgress reads the completion bitmap at path, or returns a fresh all-false bitmap of length n if path is
+// empty or doesn't exist yet.
+func loadProgress(path string, n int) ([]bool, error) {
+	if path == "" {
+		return make([]bool, n), nil
+	}
+
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return make([]bool, n), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var done []bool
+	if err := gob.NewDecoder(f).Decode(&done); err != nil {
+		return nil, err
+	}
+	if len(done) != n {
+		return nil, errors.Errorf("rsync: progress file %s has %d segments, plan has %d", path, len(done), n)
+	}
+	return done, nil
+}
+
+// saveProgress writes the completion bitmap to path, via a temp file and rename so a reader never observes a
+// half-written bitmap. It's a no-op when path is empty.
+func saveProgress(path string, done []bool) error {
+	if path == "" {
+		return nil
+	}
+
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if err := gob.NewEncoder(f).Encode(done); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,192 @@
+package rsync
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+// memWriterAt is an io.WriterAt backed by an in-memory buffer, growing (and supporting Truncate) the way a real
+// destination file would, so Apply's preallocate-then-write-anywhere behavior can be exercised without touching disk.
+type memWriterAt struct {
+	mu   sync.Mutex
+	data []byte
+}
+
+func (w *memWriterAt) Truncate(size int64) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if int64(len(w.data)) < size {
+		w.data = append(w.data, make([]byte, size-int64(len(w.data)))...)
+	} else {
+		w.data = w.data[:size]
+	}
+	return nil
+}
+
+func (w *memWriterAt) WriteAt(p []byte, off int64) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if end := off + int64(len(p)); end > int64(len(w.data)) {
+		w.data = append(w.data, make([]byte, end-int64(len(w.data)))...)
+	}
+	copy(w.data[off:], p)
+	return len(p), nil
+}
+
+func (w *memWriterAt) bytes() []byte {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return append([]byte{}, w.data...)
+}
+
+// failAfterN wraps a WriterAt and fails every call once n successful writes have gone through, to simulate an
+// Apply interrupted partway.
+type failAfterN struct {
+	io.WriterAt
+	n int
+}
+
+func (w *failAfterN) WriteAt(p []byte, off int64) (int, error) {
+	if w.n <= 0 {
+		return 0, errors.New("simulated write failure")
+	}
+	w.n--
+	return w.WriterAt.WriteAt(p, off)
+}
+
+func literalPlan(segs int, segLen int) *Plan {
+	plan := &Plan{}
+	for i := 0; i < segs; i++ {
+		data := bytes.Repeat([]byte{byte('A' + i)}, segLen)
+		plan.Segments = append(plan.Segments, Segment{
+			DstOffset:    plan.Size,
+			Length:       int64(segLen),
+			RemoteOffset: -1,
+			Data:         data,
+		})
+		plan.Size += int64(segLen)
+	}
+	return plan
+}
+
+// TestApplyResumesFromProgress checks the property progressPath exists for: an Apply interrupted partway through
+// a plan, then re-run with the same plan and progressPath, skips the segments the bitmap already marked done and
+// finishes with the same result a single uninterrupted Apply would have produced.
+func TestApplyResumesFromProgress(t *testing.T) {
+	plan := literalPlan(6, 16)
+	progressPath := filepath.Join(t.TempDir(), "progress")
+
+	dst := &memWriterAt{}
+	failing := &failAfterN{WriterAt: dst, n: 3}
+	if err := Apply(context.Background(), plan, failing, nil, 1, progressPath); err == nil {
+		t.Fatal("Apply with a failing WriterAt returned no error")
+	}
+
+	done, err := loadProgress(progressPath, len(plan.Segments))
+	if err != nil {
+		t.Fatalf("loadProgress after interrupted Apply: %v", err)
+	}
+	gotDone := 0
+	for _, ok := range done {
+		if ok {
+			gotDone++
+		}
+	}
+	if gotDone != 3 {
+		t.Fatalf("progress bitmap has %d segments done, want 3", gotDone)
+	}
+
+	counting := &countingWriterAt{WriterAt: dst}
+	if err := Apply(context.Background(), plan, counting, nil, 1, progressPath); err != nil {
+		t.Fatalf("resumed Apply: %v", err)
+	}
+	if counting.writes != 3 {
+		t.Fatalf("resumed Apply issued %d WriteAt calls, want 3 (the segments left undone)", counting.writes)
+	}
+
+	want := literalPlan(6, 16)
+	var wantBytes []byte
+	for _, seg := range want.Segments {
+		wantBytes = append(wantBytes, seg.Data...)
+	}
+	if got := dst.bytes(); !bytes.Equal(got, wantBytes) {
+		t.Fatalf("resumed Apply's output = %x, want %x", got, wantBytes)
+	}
+}
+
+// countingWriterAt wraps a WriterAt and counts how many WriteAt calls go through it.
+type countingWriterAt struct {
+	io.WriterAt
+	writes int
+}
+
+func (w *countingWriterAt) WriteAt(p []byte, off int64) (int, error) {
+	w.writes++
+	return w.WriterAt.WriteAt(p, off)
+}
+
+// TestBuildPlanAndApply checks the non-resuming path end to end: BuildPlan assembles a Plan from a channel of
+// BlockOperations, and Apply reconstructs the exact bytes the operations described.
+func TestBuildPlanAndApply(t *testing.T) {
+	remote := []byte("the quick brown fox jumps over the lazy dog")
+	ops := make(chan BlockOperation, 2)
+	ops <- BlockOperation{Index: 0, Kind: OpCopy, RemoteOffset: 4, Length: 5} // "quick"
+	ops <- BlockOperation{Index: 1, Kind: OpLiteral, Data: []byte(" cat")}
+	close(ops)
+
+	plan, err := BuildPlan(context.Background(), ops)
+	if err != nil {
+		t.Fatalf("BuildPlan: %v", err)
+	}
+	if plan.Size != 9 {
+		t.Fatalf("plan.Size = %d, want 9", plan.Size)
+	}
+
+	dst := &memWriterAt{}
+	if err := Apply(context.Background(), plan, dst, bytes.NewReader(remote), 2, ""); err != nil {
+		t.Fatalf("Apply: %v", err)
+	}
+	if got, want := string(dst.bytes()), "quick cat"; got != want {
+		t.Fatalf("Apply produced %q, want %q", got, want)
+	}
+}
+
+// TestBuildPlanRejectsTemporarySource checks BuildPlan's documented refusal to handle a copy sourced from the
+// receiver's temporary file, since Apply has nowhere to resolve it from.
+func TestBuildPlanRejectsTemporarySource(t *testing.T) {
+	ops := make(chan BlockOperation, 1)
+	ops <- BlockOperation{Index: 0, Kind: OpCopy, Source: SourceTemporary, RemoteOffset: 0, Length: 4}
+	close(ops)
+
+	if _, err := BuildPlan(context.Background(), ops); err == nil {
+		t.Fatal("BuildPlan accepted a SourceTemporary copy op")
+	}
+}
+
+// TestSavePlanLoadPlanRoundTrip checks that a Plan persisted with SavePlan and reloaded with LoadPlan is identical
+// to the original, since a resumed Apply depends on the reloaded plan describing the exact same segments.
+func TestSavePlanLoadPlanRoundTrip(t *testing.T) {
+	plan := literalPlan(3, 8)
+	path := filepath.Join(t.TempDir(), "plan")
+
+	if err := SavePlan(path, plan); err != nil {
+		t.Fatalf("SavePlan: %v", err)
+	}
+	loaded, err := LoadPlan(path)
+	if err != nil {
+		t.Fatalf("LoadPlan: %v", err)
+	}
+	if loaded.Size != plan.Size || len(loaded.Segments) != len(plan.Segments) {
+		t.Fatalf("LoadPlan = %+v, want %+v", loaded, plan)
+	}
+	for i := range plan.Segments {
+		if !bytes.Equal(loaded.Segments[i].Data, plan.Segments[i].Data) {
+			t.Fatalf("segment %d data = %x, want %x", i, loaded.Segments[i].Data, plan.Segments[i].Data)
+		}
+	}
+}
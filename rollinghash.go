@@ -0,0 +1,37 @@
+package rsync
+
+// rollingChecksum is the incremental state of the rsync-style weak checksum over a sliding window of bytes. It lets
+// Sync advance the window one byte at a time in O(1) instead of re-summing the whole block on every shift.
+type rollingChecksum struct {
+	s1, s2 uint32
+	n      uint32 // window size
+}
+
+// newRollingChecksum computes the initial checksum over block and returns a rollingChecksum that can be advanced
+// one byte at a time with Roll.
+func newRollingChecksum(block []byte) *rollingChecksum {
+	var s1, s2 uint32
+	n := uint32(len(block))
+	for i, b := range block {
+		s1 += uint32(b)
+		s2 += (n - uint32(i)) * uint32(b)
+	}
+	return &rollingChecksum{s1: s1, s2: s2, n: n}
+}
+
+// Sum returns the current 32-bit weak checksum value for the window.
+func (r *rollingChecksum) Sum() uint32 {
+	return r.s1 + (r.s2 << 16)
+}
+
+// Roll advances the window by one byte: out is the byte leaving the window, in is the byte entering it.
+func (r *rollingChecksum) Roll(out, in byte) {
+	r.s1 = r.s1 - uint32(out) + uint32(in)
+	r.s2 = r.s2 - r.n*uint32(out) + r.s1
+}
+
+// rollingHash computes the weak checksum of block from scratch. It's equivalent to
+// newRollingChecksum(block).Sum(), and is used where no incremental state is needed (e.g. signature generation).
+func rollingHash(block []byte) uint32 {
+	return newRollingChecksum(block).Sum()
+}
@@ -0,0 +1,35 @@
+package rsync
+
+import (
+	"math/rand"
+	"testing"
+)
+
+// TestRollingChecksumMatchesFromScratch checks that Roll's incremental update agrees with recomputing the weak
+// checksum from scratch over the same window, at every position as the window slides across a random byte stream.
+func TestRollingChecksumMatchesFromScratch(t *testing.T) {
+	data := make([]byte, 1000)
+	rand.New(rand.NewSource(1)).Read(data)
+
+	const winLen = 37
+	rc := newRollingChecksum(data[:winLen])
+	for pos := 0; pos+winLen < len(data); pos++ {
+		want := rollingHash(data[pos : pos+winLen])
+		if got := rc.Sum(); got != want {
+			t.Fatalf("pos %d: rolling sum = %d, want %d (from scratch)", pos, got, want)
+		}
+		rc.Roll(data[pos], data[pos+winLen])
+	}
+}
+
+// TestRollingChecksumDetectsChange checks that changing a single byte inside the window changes the checksum,
+// i.e. the weak hash isn't degenerate for ordinary input.
+func TestRollingChecksumDetectsChange(t *testing.T) {
+	a := []byte("the quick brown fox jumps over the lazy dog")
+	b := append([]byte(nil), a...)
+	b[10] = 'X'
+
+	if rollingHash(a) == rollingHash(b) {
+		t.Fatalf("rollingHash(a) == rollingHash(b) for differing blocks %q vs %q", a, b)
+	}
+}
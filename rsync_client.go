@@ -3,78 +3,316 @@ package rsync
 import (
 	"bytes"
 	"context"
-	"hash"
 	"io"
 
 	"github.com/golang/glog"
 	"github.com/pkg/errors"
 )
 
-// Sync sends file deltas or literals to the caller in order to efficiently re-construct a remote file. Whether to send
-// data or literals is determined by the checksums received from the caller.
-func Sync(ctx context.Context, r io.Reader, shash hash.Hash, c <-chan BlockChecksum) chan<- BlockOperation {
-	// Build lookup table using remote signatures
+// readAhead is the chunk size used to refill the sliding window buffer from r.
+const readAhead = 64 * 1024
+
+// Sync sends file deltas or literals to the caller in order to efficiently re-construct a remote file. Whether to
+// send data or literals is determined by the checksums in sig, which must have been hashed with algo -- Sync
+// rejects sig if its Algo doesn't match, rather than silently comparing checksums produced by two different
+// algorithms.
+//
+// A nil chunker, or a FixedSize chunker, uses a true byte-by-byte sliding window: the weak checksum is updated in
+// O(1) per byte advance rather than recomputed over fixed, non-overlapping blocks, so an insertion or deletion in
+// the middle of the file only desynchronizes the match until the window re-aligns on the next matching block,
+// instead of defeating delta detection for the remainder of the file. Any other Chunker (e.g. FastCDC) is matched
+// one chunk at a time instead, since content-defined chunk boundaries already re-synchronize around an edit
+// without needing a byte-level scan.
+//
+// opts controls optional, riskier matching behavior; the zero value is the conservative default (strong-hash
+// confirmation required, matches only against the finalized remote file).
+func Sync(ctx context.Context, r io.Reader, chunker Chunker, algo HashAlgo, sig SignatureStream, opts SyncOptions) chan BlockOperation {
+	if sig.Algo != algo {
+		o := make(chan BlockOperation, 1)
+		o <- BlockOperation{Error: errors.Errorf("rsync: signature stream uses %s, Sync expected %s", sig.Algo, algo)}
+		close(o)
+		return o
+	}
+
+	hasher, err := algo.Hasher()
+	if err != nil {
+		o := make(chan BlockOperation, 1)
+		o <- BlockOperation{Error: err}
+		close(o)
+		return o
+	}
+
+	t := buildChecksumTable(sig.Blocks, opts)
+
+	if fs, ok := chunker.(FixedSize); ok {
+		size := fs.Size
+		if size <= 0 {
+			size = DefaultBlockSize
+		}
+		return syncFixed(ctx, r, size, hasher, t, opts)
+	}
+	if chunker == nil {
+		return syncFixed(ctx, r, DefaultBlockSize, hasher, t, opts)
+	}
+	return syncChunks(ctx, r, chunker, hasher, t, opts)
+}
+
+// buildChecksumTable drains c into a lookup table keyed by weak checksum, logging (but not failing on) any
+// per-block errors the remote end reported. Checksums describing the receiver's temporary/staging file are
+// dropped unless opts.AllowTemporarySource is set.
+func buildChecksumTable(c <-chan BlockChecksum, opts SyncOptions) map[uint32][]BlockChecksum {
 	t := make(map[uint32][]BlockChecksum)
 	for sum := range c {
 		if sum.Error != nil {
 			// we continue reading just fine and print out a warning. Worst case scenario, the involved
 			// data block is re-sent.
 			glog.Warningf("block checksum error: %+v", sum.Error)
+			continue
 		}
-
-		k := sum.Weak
-		t[k] = append(t[k], sum)
+		if sum.Temporary && !opts.AllowTemporarySource {
+			continue
+		}
+		t[sum.Weak] = append(t[sum.Weak], sum)
 	}
+	return t
+}
 
-	var index uint64
-	buffer := make([]byte, 0, DefaultBlockSize)
-	o := make(chan<- BlockOperation)
+// syncFixed implements Sync's default fixed-block-size path with a true sliding window over the input.
+func syncFixed(ctx context.Context, r io.Reader, k int, hasher StrongHasher, t map[uint32][]BlockChecksum, opts SyncOptions) chan BlockOperation {
+	o := make(chan BlockOperation)
 
 	go func() {
 		defer close(o)
-		// Read the file, see if there are content matches against remote blocks and send literal or data operation.
-		for {
-			// Allow for cancellation.
+
+		buf := make([]byte, 0, readAhead)
+		pos, emitStart := 0, 0
+		var index uint64
+
+		// fill reads more bytes from r into buf, first discarding bytes before emitStart since they've already
+		// been emitted and are no longer needed.
+		fill := func() error {
+			if emitStart > 0 {
+				buf = append(buf[:0], buf[emitStart:]...)
+				pos -= emitStart
+				emitStart = 0
+			}
+			if cap(buf)-len(buf) < readAhead {
+				grown := make([]byte, len(buf), len(buf)+readAhead)
+				copy(grown, buf)
+				buf = grown
+			}
+			// r.Read may return fewer bytes than requested without an error (the io.Reader contract permits
+			// this), so loop until the available space is full or r is exhausted -- a single short Read used
+			// to be silently treated as end of input, truncating the sync.
+			n, err := io.ReadFull(r, buf[len(buf):cap(buf)])
+			buf = buf[:len(buf)+n]
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				return nil
+			}
+			return err
+		}
+
+		// emit sends op on o, or bails out if the context is cancelled first. It reports whether the caller
+		// should keep going.
+		emit := func(op BlockOperation) bool {
 			select {
 			case <-ctx.Done():
 				o <- BlockOperation{Error: ctx.Err()}
+				return false
+			case o <- op:
+				return true
+			}
+		}
+
+		// flushLiteral emits buf[emitStart:end] as a literal op, if non-empty, advancing emitStart past it. It
+		// reports whether the caller should keep going.
+		flushLiteral := func(end int) bool {
+			if end <= emitStart {
+				return true
+			}
+			if !emit(BlockOperation{Index: index, Kind: OpLiteral, Data: append([]byte(nil), buf[emitStart:end]...)}) {
+				return false
+			}
+			index++
+			emitStart = end
+			return true
+		}
+
+		if err := fill(); err != nil {
+			emit(BlockOperation{Error: errors.Wrapf(err, "failed reading file")})
+			return
+		}
+
+		winLen := k
+		if len(buf)-pos < winLen {
+			winLen = len(buf) - pos
+		}
+		var rc *rollingChecksum
+		if winLen > 0 {
+			rc = newRollingChecksum(buf[pos : pos+winLen])
+		}
+
+		for winLen == k {
+			select {
+			case <-ctx.Done():
+				emit(BlockOperation{Error: ctx.Err()})
 				return
 			default:
-				// break out of the select block and continue reading
-				break
 			}
 
-			n, err := r.Read(buffer)
-			if err == io.EOF {
+			if bs, ok := t[rc.Sum()]; ok {
+				window := buf[pos : pos+winLen]
+				if matched, weakOnly := pickMatch(bs, window, hasher, opts); matched != nil {
+					if !flushLiteral(pos) {
+						return
+					}
+					op := BlockOperation{
+						Index: index, Kind: OpCopy, IndexB: matched.Index,
+						RemoteOffset: matched.Offset, Length: matched.Length, WeakOnly: weakOnly,
+					}
+					if matched.Temporary {
+						op.Source = SourceTemporary
+					}
+					if !emit(op) {
+						return
+					}
+					index++
+
+					pos += winLen
+					emitStart = pos
+					if len(buf)-pos < k {
+						if err := fill(); err != nil {
+							emit(BlockOperation{Error: errors.Wrapf(err, "failed reading file")})
+							return
+						}
+					}
+					winLen = k
+					if len(buf)-pos < winLen {
+						winLen = len(buf) - pos
+					}
+					if winLen > 0 {
+						rc = newRollingChecksum(buf[pos : pos+winLen])
+					}
+					continue
+				}
+			}
+
+			// No match at this position: slide the window forward by one byte, extending the pending literal
+			// run that will be flushed the next time we find (or give up looking for) a match.
+			if len(buf)-pos <= winLen {
+				if err := fill(); err != nil {
+					emit(BlockOperation{Error: errors.Wrapf(err, "failed reading file")})
+					return
+				}
+			}
+			if len(buf)-(pos+1) < winLen {
+				// Not enough bytes left to roll the window forward; stop matching and flush the tail below.
 				break
 			}
+			rc.Roll(buf[pos], buf[pos+winLen])
+			pos++
 
-			if err != nil {
-				o <- BlockOperation{Error: errors.Wrapf(err, "failed reading file")}
-				// return since data corruption in the server is possible and a re-sync is required.
-				return
+			// Flush the pending literal run once it reaches readAhead rather than letting it grow for the rest
+			// of the file: on a file with few or no matches, buf would otherwise buffer (and a single OpLiteral
+			// would carry) the entire remainder of the input, defeating the whole point of streaming the sync.
+			if pos-emitStart >= readAhead {
+				if !flushLiteral(pos) {
+					return
+				}
 			}
+		}
+
+		flushLiteral(len(buf))
+	}()
 
-			block := buffer[:n]
-			weak := rollingHash(block)
+	return o
+}
+
+// syncChunks implements Sync's path for non-fixed-size Chunkers: it re-chunks r with chunker and matches each
+// resulting chunk against t as a whole, relying on the chunker's own boundaries (rather than a byte-level scan) to
+// re-synchronize after an insertion or deletion.
+func syncChunks(ctx context.Context, r io.Reader, chunker Chunker, hasher StrongHasher, t map[uint32][]BlockChecksum, opts SyncOptions) chan BlockOperation {
+	o := make(chan BlockOperation)
+
+	go func() {
+		defer close(o)
+
+		var index uint64
+		for chunk := range chunker.Chunks(ctx, r) {
+			select {
+			case <-ctx.Done():
+				o <- BlockOperation{Error: ctx.Err()}
+				return
+			default:
+			}
 
 			op := BlockOperation{Index: index}
-			if bs, ok := t[weak]; ok {
-				for _, b := range bs {
-					if bytes.Compare(shash.Sum(block), b.Strong) == 0 {
-						// instructs the remote end to copy block data at offset b.Index
-						// from remote file.
-						op.IndexB = b.Index
+			if chunk.Err != nil {
+				op.Error = errors.Wrapf(chunk.Err, "reading file")
+			} else if bs, ok := t[rollingHash(chunk.Data)]; ok {
+				if matched, weakOnly := pickMatch(bs, chunk.Data, hasher, opts); matched != nil {
+					op.Kind = OpCopy
+					op.IndexB = matched.Index
+					op.RemoteOffset = matched.Offset
+					op.Length = matched.Length
+					op.WeakOnly = weakOnly
+					if matched.Temporary {
+						op.Source = SourceTemporary
 					}
 				}
-			} else {
-				op.Data = block
+			}
+			if op.Error == nil && op.Kind != OpCopy {
+				op.Kind = OpLiteral
+				op.Data = chunk.Data
 			}
 
-			o <- op
+			select {
+			case o <- op:
+			case <-ctx.Done():
+				o <- BlockOperation{Error: ctx.Err()}
+				return
+			}
+			if op.Error != nil {
+				return
+			}
 			index++
 		}
 	}()
 
 	return o
 }
+
+// matchChecksum looks up data's weak checksum in t and, on a candidate hit, confirms the match against data's
+// already-computed strong checksum. It returns the matching remote block, or nil if none was confirmed.
+func matchChecksum(t map[uint32][]BlockChecksum, data, strong []byte) *BlockChecksum {
+	return confirmMatch(t[rollingHash(data)], strong)
+}
+
+// confirmMatch scans candidates (all sharing a weak-checksum match) for one whose strong checksum equals strong,
+// returning it, or nil if none matches.
+func confirmMatch(candidates []BlockChecksum, strong []byte) *BlockChecksum {
+	for i := range candidates {
+		if bytes.Equal(strong, candidates[i].Strong) {
+			return &candidates[i]
+		}
+	}
+	return nil
+}
+
+// pickMatch chooses a matching remote block among candidates (all sharing a weak-checksum match on data). When
+// opts.TrustWeakHash is set it trusts the first same-length candidate without strong-hash confirmation (reporting
+// weakOnly so the caller can mark the operation accordingly) -- a weak-hash collision against a different-length
+// candidate is rejected outright rather than accepted, since the caller always advances by len(data) regardless of
+// the matched block's length, and substituting a different length there would desync every byte emitted after it.
+// Otherwise it confirms against data's strong checksum as usual.
+func pickMatch(candidates []BlockChecksum, data []byte, hasher StrongHasher, opts SyncOptions) (matched *BlockChecksum, weakOnly bool) {
+	if opts.TrustWeakHash {
+		for i := range candidates {
+			if candidates[i].Length == int64(len(data)) {
+				return &candidates[i], true
+			}
+		}
+		return nil, false
+	}
+	return confirmMatch(candidates, hasher.Sum(nil, data)), false
+}
@@ -0,0 +1,83 @@
+package rsync
+
+import (
+	"bytes"
+	"context"
+	"testing"
+)
+
+// TestPickMatchTrustWeakHashRejectsLengthMismatch checks the bug this package used to have: a TrustWeakHash match
+// whose candidate Length disagrees with the window actually hashed must be rejected, not accepted, since the
+// caller always advances by len(data) regardless of the matched block's length -- accepting a mismatched length
+// here would desync every byte Sync emits after it, not just the one block.
+func TestPickMatchTrustWeakHashRejectsLengthMismatch(t *testing.T) {
+	data := []byte("0123456789")
+	candidates := []BlockChecksum{{Index: 0, Length: int64(len(data) - 1)}}
+
+	matched, weakOnly := pickMatch(candidates, data, nil, SyncOptions{TrustWeakHash: true})
+	if matched != nil {
+		t.Fatalf("pickMatch accepted a length-mismatched TrustWeakHash candidate: %+v", matched)
+	}
+	if weakOnly {
+		t.Fatal("pickMatch reported weakOnly with no match")
+	}
+}
+
+// TestPickMatchTrustWeakHashAcceptsLengthMatch checks the accepting side of the same rule: a same-length candidate
+// is trusted without strong-hash confirmation.
+func TestPickMatchTrustWeakHashAcceptsLengthMatch(t *testing.T) {
+	data := []byte("0123456789")
+	candidates := []BlockChecksum{{Index: 0, Length: int64(len(data))}}
+
+	matched, weakOnly := pickMatch(candidates, data, nil, SyncOptions{TrustWeakHash: true})
+	if matched == nil || matched.Index != 0 {
+		t.Fatalf("pickMatch = %+v, want the length-matched candidate", matched)
+	}
+	if !weakOnly {
+		t.Fatal("pickMatch didn't report weakOnly for a TrustWeakHash match")
+	}
+}
+
+// TestSyncAllowTemporarySource checks that a BlockChecksum marked Temporary is only ever proposed as a match when
+// SyncOptions.AllowTemporarySource is set, and that the resulting op is tagged Source == SourceTemporary so the
+// caller knows to resolve it against its own staging file rather than the finalized remote.
+func TestSyncAllowTemporarySource(t *testing.T) {
+	data := bytes.Repeat([]byte("X"), DefaultBlockSize)
+	hasher, err := HashSHA256.Hasher()
+	if err != nil {
+		t.Fatalf("Hasher: %v", err)
+	}
+	checksum := BlockChecksum{
+		Index:     0,
+		Offset:    0,
+		Length:    int64(len(data)),
+		Weak:      rollingHash(data),
+		Strong:    hasher.Sum(nil, data),
+		Temporary: true,
+	}
+
+	sigFor := func() SignatureStream {
+		c := make(chan BlockChecksum, 1)
+		c <- checksum
+		close(c)
+		return SignatureStream{Algo: HashSHA256, Blocks: c}
+	}
+
+	// Without AllowTemporarySource, the temporary checksum is dropped and the block comes back as a literal.
+	var ops []BlockOperation
+	for op := range Sync(context.Background(), bytes.NewReader(data), FixedSize{Size: DefaultBlockSize}, HashSHA256, sigFor(), SyncOptions{}) {
+		ops = append(ops, op)
+	}
+	if len(ops) != 1 || ops[0].Kind != OpLiteral {
+		t.Fatalf("ops = %+v, want a single OpLiteral (temporary checksum should have been ignored)", ops)
+	}
+
+	// With AllowTemporarySource, the same checksum is proposed and the resulting copy is tagged SourceTemporary.
+	ops = nil
+	for op := range Sync(context.Background(), bytes.NewReader(data), FixedSize{Size: DefaultBlockSize}, HashSHA256, sigFor(), SyncOptions{AllowTemporarySource: true}) {
+		ops = append(ops, op)
+	}
+	if len(ops) != 1 || ops[0].Kind != OpCopy || ops[0].Source != SourceTemporary {
+		t.Fatalf("ops = %+v, want a single OpCopy with Source == SourceTemporary", ops)
+	}
+}
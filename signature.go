@@ -0,0 +1,47 @@
+package rsync
+
+import (
+	"context"
+	"io"
+)
+
+// Signature reads r to completion using chunker and emits a BlockChecksum for each resulting block, in order,
+// strong-hashed with algo. The caller sends the resulting SignatureStream to the remote end so Sync there can find
+// blocks it doesn't need to re-send. A nil chunker chunks r into fixed DefaultBlockSize blocks.
+func Signature(ctx context.Context, r io.Reader, chunker Chunker, algo HashAlgo) (SignatureStream, error) {
+	hasher, err := algo.Hasher()
+	if err != nil {
+		return SignatureStream{}, err
+	}
+	if chunker == nil {
+		chunker = FixedSize{Size: DefaultBlockSize}
+	}
+
+	out := make(chan BlockChecksum)
+	go func() {
+		defer close(out)
+		var index uint64
+		for chunk := range chunker.Chunks(ctx, r) {
+			var sum BlockChecksum
+			if chunk.Err != nil {
+				sum = BlockChecksum{Index: index, Error: chunk.Err}
+			} else {
+				sum = BlockChecksum{
+					Index:  index,
+					Offset: chunk.Offset,
+					Length: int64(len(chunk.Data)),
+					Weak:   rollingHash(chunk.Data),
+					Strong: hasher.Sum(nil, chunk.Data),
+				}
+			}
+			select {
+			case out <- sum:
+			case <-ctx.Done():
+				return
+			}
+			index++
+		}
+	}()
+
+	return SignatureStream{Algo: algo, Blocks: out}, nil
+}
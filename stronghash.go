@@ -0,0 +1,88 @@
+package rsync
+
+import (
+	"crypto/sha256"
+	"fmt"
+
+	"github.com/zeebo/blake3"
+	"github.com/zeebo/xxh3"
+)
+
+// StrongHasher computes a block's strong (match-confirming) checksum. Unlike hash.Hash it hashes a whole block in
+// one call instead of through Write, so implementations can take a non-streaming fast path where one exists.
+type StrongHasher interface {
+	// Sum appends the checksum of block to dst and returns the resulting slice, mirroring hash.Hash.Sum.
+	Sum(dst, block []byte) []byte
+	// Size returns the length, in bytes, the checksum occupies.
+	Size() int
+}
+
+// HashAlgo identifies a StrongHasher implementation. It's carried alongside a signature stream (see
+// SignatureStream) so the receiving side of a sync can reject a stream hashed with an algorithm it didn't expect,
+// rather than silently comparing checksums produced by two different algorithms.
+type HashAlgo uint8
+
+const (
+	// HashSHA256 is the default, cryptographically secure strong hash.
+	HashSHA256 HashAlgo = iota
+	// HashBLAKE3 is cryptographically secure and substantially faster than SHA-256 on modern CPUs.
+	HashBLAKE3
+	// HashXXH3 is the fastest option, but is not cryptographically secure. See the security note in doc.go
+	// before using it on untrusted input.
+	HashXXH3
+)
+
+// String implements fmt.Stringer.
+func (a HashAlgo) String() string {
+	switch a {
+	case HashSHA256:
+		return "sha256"
+	case HashBLAKE3:
+		return "blake3"
+	case HashXXH3:
+		return "xxh3-128"
+	default:
+		return fmt.Sprintf("HashAlgo(%d)", uint8(a))
+	}
+}
+
+// Hasher returns a new StrongHasher for a, or an error if a is not a recognized algorithm.
+func (a HashAlgo) Hasher() (StrongHasher, error) {
+	switch a {
+	case HashSHA256:
+		return sha256Hasher{}, nil
+	case HashBLAKE3:
+		return blake3Hasher{}, nil
+	case HashXXH3:
+		return xxh3Hasher{}, nil
+	default:
+		return nil, fmt.Errorf("rsync: unknown hash algorithm %d", uint8(a))
+	}
+}
+
+type sha256Hasher struct{}
+
+func (sha256Hasher) Sum(dst, block []byte) []byte {
+	sum := sha256.Sum256(block)
+	return append(dst, sum[:]...)
+}
+
+func (sha256Hasher) Size() int { return sha256.Size }
+
+type blake3Hasher struct{}
+
+func (blake3Hasher) Sum(dst, block []byte) []byte {
+	sum := blake3.Sum256(block)
+	return append(dst, sum[:]...)
+}
+
+func (blake3Hasher) Size() int { return 32 }
+
+type xxh3Hasher struct{}
+
+func (xxh3Hasher) Sum(dst, block []byte) []byte {
+	sum := xxh3.Hash128(block).Bytes()
+	return append(dst, sum[:]...)
+}
+
+func (xxh3Hasher) Size() int { return 16 }
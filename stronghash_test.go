@@ -0,0 +1,58 @@
+package rsync
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+)
+
+// TestHasherSizeMatchesSumLength checks that every HashAlgo's declared Size agrees with the actual length of the
+// checksum Sum produces, and that hashing is deterministic (the same block hashes the same way twice).
+func TestHasherSizeMatchesSumLength(t *testing.T) {
+	block := make([]byte, 4096)
+	rand.New(rand.NewSource(3)).Read(block)
+
+	for _, algo := range []HashAlgo{HashSHA256, HashBLAKE3, HashXXH3} {
+		t.Run(algo.String(), func(t *testing.T) {
+			hasher, err := algo.Hasher()
+			if err != nil {
+				t.Fatalf("Hasher: %v", err)
+			}
+			sum := hasher.Sum(nil, block)
+			if len(sum) != hasher.Size() {
+				t.Fatalf("len(Sum) = %d, Size() = %d", len(sum), hasher.Size())
+			}
+			if again := hasher.Sum(nil, block); !bytes.Equal(sum, again) {
+				t.Fatalf("hashing the same block twice produced different checksums")
+			}
+		})
+	}
+}
+
+// TestUnknownHashAlgo checks that Hasher rejects an out-of-range HashAlgo instead of panicking or silently
+// returning a usable hasher.
+func TestUnknownHashAlgo(t *testing.T) {
+	if _, err := HashAlgo(99).Hasher(); err == nil {
+		t.Fatal("Hasher on an unknown algorithm returned no error")
+	}
+}
+
+// BenchmarkStrongHashers compares SHA-256, BLAKE3, and xxh3-128 throughput over a typical block size, to
+// substantiate the speedup the request asked for when choosing a non-default StrongHasher.
+func BenchmarkStrongHashers(b *testing.B) {
+	block := make([]byte, DefaultBlockSize)
+	rand.New(rand.NewSource(4)).Read(block)
+
+	for _, algo := range []HashAlgo{HashSHA256, HashBLAKE3, HashXXH3} {
+		hasher, err := algo.Hasher()
+		if err != nil {
+			b.Fatalf("Hasher: %v", err)
+		}
+		b.Run(algo.String(), func(b *testing.B) {
+			b.SetBytes(int64(len(block)))
+			for i := 0; i < b.N; i++ {
+				hasher.Sum(nil, block)
+			}
+		})
+	}
+}
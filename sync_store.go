@@ -0,0 +1,110 @@
+package rsync
+
+import (
+	"context"
+	"io"
+
+	"github.com/golang/glog"
+	"github.com/pkg/errors"
+	"github.com/tomzhang/gsync/blockstore"
+)
+
+// SyncWithStore behaves like Sync, but additionally dedups against store: before emitting a literal for a chunk
+// that doesn't match the remote's signature, it checks whether an identical block (by strong hash) has already
+// been stored by some other sync, and if so emits an OpStoreRef instead of re-sending the bytes. Otherwise the new
+// block is written to store so future syncs of other files can reference it. A nil chunker chunks r into fixed
+// DefaultBlockSize blocks.
+func SyncWithStore(ctx context.Context, r io.Reader, chunker Chunker, algo HashAlgo, sig SignatureStream, store blockstore.Store) chan BlockOperation {
+	if sig.Algo != algo {
+		o := make(chan BlockOperation, 1)
+		o <- BlockOperation{Error: errors.Errorf("rsync: signature stream uses %s, SyncWithStore expected %s", sig.Algo, algo)}
+		close(o)
+		return o
+	}
+
+	hasher, err := algo.Hasher()
+	if err != nil {
+		o := make(chan BlockOperation, 1)
+		o <- BlockOperation{Error: err}
+		close(o)
+		return o
+	}
+
+	if chunker == nil {
+		chunker = FixedSize{Size: DefaultBlockSize}
+	}
+	t := buildChecksumTable(sig.Blocks, SyncOptions{})
+
+	o := make(chan BlockOperation)
+	go func() {
+		defer close(o)
+
+		var index uint64
+		for chunk := range chunker.Chunks(ctx, r) {
+			select {
+			case <-ctx.Done():
+				o <- BlockOperation{Error: ctx.Err()}
+				return
+			default:
+			}
+
+			op := BlockOperation{Index: index}
+			if chunk.Err != nil {
+				op.Error = errors.Wrapf(chunk.Err, "reading file")
+				select {
+				case o <- op:
+				case <-ctx.Done():
+				}
+				return
+			}
+
+			strong := hasher.Sum(nil, chunk.Data)
+
+			switch matched, has, err := matchOrStored(t, store, chunk.Data, strong); {
+			case err != nil:
+				op.Error = errors.Wrapf(err, "checking block store")
+			case matched != nil:
+				op.Kind = OpCopy
+				op.IndexB = matched.Index
+				op.RemoteOffset = matched.Offset
+				op.Length = matched.Length
+			case has:
+				op.Kind = OpStoreRef
+				op.StoreRef = strong
+				op.Length = int64(len(chunk.Data))
+			default:
+				if err := store.Put(strong, chunk.Data); err != nil {
+					glog.Warningf("failed storing block in block store: %+v", err)
+				}
+				op.Kind = OpLiteral
+				op.Data = chunk.Data
+			}
+
+			select {
+			case o <- op:
+			case <-ctx.Done():
+				o <- BlockOperation{Error: ctx.Err()}
+				return
+			}
+			if op.Error != nil {
+				return
+			}
+			index++
+		}
+	}()
+
+	return o
+}
+
+// matchOrStored checks data against the remote signature table first, then against store, returning the matching
+// remote block (if any) and whether the block is already present in store.
+func matchOrStored(t map[uint32][]BlockChecksum, store blockstore.Store, data, strong []byte) (*BlockChecksum, bool, error) {
+	if matched := matchChecksum(t, data, strong); matched != nil {
+		return matched, false, nil
+	}
+	has, err := store.Has(strong)
+	if err != nil {
+		return nil, false, err
+	}
+	return nil, has, nil
+}
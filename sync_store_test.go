@@ -0,0 +1,52 @@
+package rsync
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/tomzhang/gsync/blockstore"
+)
+
+// TestSyncWithStoreDedups checks the cross-file dedup path SyncWithStore exists for: a block with no remote
+// signature match, but already present in the shared store from an earlier sync, is referenced with OpStoreRef
+// instead of being re-sent as a literal.
+func TestSyncWithStoreDedups(t *testing.T) {
+	store := blockstore.NewMemStore()
+	ctx := context.Background()
+
+	shared := bytes.Repeat([]byte("A"), DefaultBlockSize)
+	fileA := append(append([]byte{}, shared...), bytes.Repeat([]byte("B"), DefaultBlockSize)...)
+
+	// First sync: nothing on the remote end and nothing in the store yet, so both blocks of fileA should come
+	// back as literals (and be written into the store as a side effect).
+	emptySig := SignatureStream{Algo: HashSHA256, Blocks: closedBlockChecksums()}
+	for op := range SyncWithStore(ctx, bytes.NewReader(fileA), FixedSize{Size: DefaultBlockSize}, HashSHA256, emptySig, store) {
+		if op.Error != nil {
+			t.Fatalf("unexpected error syncing fileA: %v", op.Error)
+		}
+		if op.Kind != OpLiteral {
+			t.Fatalf("fileA block %d: Kind = %v, want OpLiteral (store was empty)", op.Index, op.Kind)
+		}
+	}
+
+	// Second sync: a different file that shares its first block with fileA (so it's already in the store) but
+	// has no remote signature at all. The shared block should come back as OpStoreRef; the new block as OpLiteral.
+	fileB := append(append([]byte{}, shared...), bytes.Repeat([]byte("C"), DefaultBlockSize)...)
+	var kinds []OpKind
+	for op := range SyncWithStore(ctx, bytes.NewReader(fileB), FixedSize{Size: DefaultBlockSize}, HashSHA256, emptySig, store) {
+		if op.Error != nil {
+			t.Fatalf("unexpected error syncing fileB: %v", op.Error)
+		}
+		kinds = append(kinds, op.Kind)
+	}
+	if len(kinds) != 2 || kinds[0] != OpStoreRef || kinds[1] != OpLiteral {
+		t.Fatalf("fileB op kinds = %v, want [OpStoreRef OpLiteral]", kinds)
+	}
+}
+
+func closedBlockChecksums() <-chan BlockChecksum {
+	c := make(chan BlockChecksum)
+	close(c)
+	return c
+}